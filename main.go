@@ -0,0 +1,166 @@
+//  Copyright 2020 Alexey Volkov
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Command gcs_copy_go is a thin CLI wrapper around the pkg/gcscopy
+// library: it parses <src> and <dst> into a Filesystem each (local disk
+// or a GCS bucket) and runs a single Copier.CopyTree between them, or
+// Copier.Sync with --sync.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/Ark-kun/gcs_copy_go/pkg/gcscopy"
+)
+
+var (
+	gcsRegexp = regexp.MustCompile(`^gs://([^/]*)/(.*)$`)
+
+	parallelism = flag.Int("parallelism", gcscopy.DefaultParallelism, "Number of chunks to transfer concurrently")
+	chunkSize   = flag.Int64("chunk-size", gcscopy.DefaultChunkSize, "Size in bytes of each transfer chunk")
+
+	sync             = flag.Bool("sync", false, "Only transfer files that are missing from dst or differ in size/CRC32C, like gsutil rsync")
+	deleteExtraneous = flag.Bool("delete-extraneous", false, "With --sync, remove files under dst that are not present under src")
+
+	maxRetries    = flag.Int("max-retries", gcscopy.DefaultMaxRetries, "Number of additional attempts for a chunk or file after a retryable error (0 or less uses the default)")
+	retryDeadline = flag.Duration("retry-deadline", gcscopy.DefaultRetryDeadline, "Maximum time to spend retrying a single chunk or file (0 or less uses the default)")
+
+	preserveMetadata    = flag.Bool("preserve-metadata", false, "Carry ContentType, CacheControl, custom Metadata, storage class and ACLs over to dst, using a \".metadata.json\" sidecar when dst is local")
+	rewriteStorageClass = flag.String("rewrite-storage-class", "", "With a GCS src and dst, rewrite copied objects to this storage class instead of keeping the source's")
+)
+
+func splitGcsPath(path string) (bucket, object string, err error) {
+	matches := gcsRegexp.FindStringSubmatch(path)
+	if matches == nil {
+		return "", "", fmt.Errorf(`"%s" is not a valid GCS path`, path)
+	}
+	return matches[1], matches[2], nil
+}
+
+// filesystemFor returns the gcscopy.Filesystem that path refers to,
+// lazily creating *client the first time a GCS path is seen.
+func filesystemFor(ctx context.Context, client **storage.Client, path string) (gcscopy.Filesystem, error) {
+	bucket, object, err := splitGcsPath(path)
+	if err != nil {
+		return gcscopy.NewLocalFilesystem(path), nil
+	}
+
+	if *client == nil {
+		c, err := storage.NewClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		*client = c
+	}
+	return gcscopy.NewGcsFilesystem(*client, bucket, object), nil
+}
+
+// resolveSource is like filesystemFor, except that when from contains a
+// glob pattern it roots the Filesystem at the longest literal prefix
+// before the first wildcard and returns the remaining pattern, so the
+// caller can set it as Copier.Pattern.
+func resolveSource(ctx context.Context, client **storage.Client, from string) (gcscopy.Filesystem, string, error) {
+	if bucket, object, err := splitGcsPath(from); err == nil {
+		prefix, pattern := gcscopy.SplitGlobPrefix(object)
+		if *client == nil {
+			c, err := storage.NewClient(ctx)
+			if err != nil {
+				return nil, "", err
+			}
+			*client = c
+		}
+		return gcscopy.NewGcsFilesystem(*client, bucket, prefix), pattern, nil
+	}
+
+	prefix, pattern := gcscopy.SplitGlobPrefix(filepath.ToSlash(from))
+	return gcscopy.NewLocalFilesystem(filepath.FromSlash(prefix)), pattern, nil
+}
+
+func main() {
+	flag.Parse()
+
+	if len(flag.Args()) < 2 {
+		log.Fatalf("Usage: %s <src> <dst>", os.Args[0])
+	}
+	from, to := flag.Arg(0), flag.Arg(1)
+
+	log.Printf(`From: %s`, from)
+	log.Printf(`To: %s`, to)
+
+	ctx := context.Background()
+
+	var client *storage.Client
+	defer func() {
+		if client != nil {
+			client.Close()
+		}
+	}()
+
+	srcFs, pattern, err := resolveSource(ctx, &client, from)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dstFs, err := filesystemFor(ctx, &client, to)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	copier := gcscopy.NewCopier(srcFs, dstFs)
+	copier.Parallelism = *parallelism
+	copier.ChunkSize = *chunkSize
+	copier.Pattern = pattern
+	copier.Retry = gcscopy.RetryPolicy{MaxRetries: *maxRetries, Deadline: *retryDeadline}
+	copier.PreserveMetadata = *preserveMetadata
+
+	if *rewriteStorageClass != "" {
+		dstGcs, ok := dstFs.(*gcscopy.GcsFilesystem)
+		if !ok {
+			log.Fatal("--rewrite-storage-class requires a GCS destination")
+		}
+		dstGcs.RewriteStorageClass = *rewriteStorageClass
+	}
+
+	var fileErrs []*gcscopy.FileError
+	if *sync {
+		result, err := copier.Sync(ctx, "", "", *deleteExtraneous)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fileErrs = result.Errors
+		log.Printf("Copied %d, skipped %d, deleted %d", len(result.Copied), len(result.Skipped), len(result.Deleted))
+	} else {
+		errs, err := copier.CopyTree(ctx, "", "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fileErrs = errs
+	}
+
+	for _, fileErr := range fileErrs {
+		log.Printf("Failed to copy %q: %v", fileErr.Path, fileErr.Err)
+	}
+	if len(fileErrs) > 0 {
+		log.Printf("Finished with %d failed file(s)", len(fileErrs))
+		os.Exit(1)
+	}
+	log.Print("Finished copying")
+}
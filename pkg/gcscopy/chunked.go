@@ -0,0 +1,183 @@
+package gcscopy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+const (
+	// DefaultChunkSize is the size in bytes of each transfer chunk used
+	// when a Copier does not set ChunkSize explicitly.
+	DefaultChunkSize = 32 * 1024 * 1024 // 32 MiB
+	// DefaultParallelism is the number of chunks transferred
+	// concurrently used when a Copier does not set Parallelism
+	// explicitly.
+	DefaultParallelism = 8
+)
+
+// crc32CTable is the Castagnoli polynomial table used by GCS for the
+// CRC32C object checksum.
+var crc32CTable = crc32.MakeTable(crc32.Castagnoli)
+
+// maxCRCMismatchAttempts bounds the total number of times
+// downloadInChunks downloads a file, re-downloading it from scratch
+// after its CRC32C fails to verify, since a mismatch usually means transient corruption in transit rather
+// than a permanently bad source.
+const maxCRCMismatchAttempts = 2
+
+// crc32CMismatchError reports that a downloaded file's CRC32C did not
+// match the source's, so downloadInChunks can tell it apart from other
+// failures and retry the whole download.
+type crc32CMismatchError struct {
+	got, want uint32
+}
+
+func (e *crc32CMismatchError) Error() string {
+	return fmt.Sprintf("CRC32C mismatch: got %d, want %d", e.got, e.want)
+}
+
+// downloadInChunks reads src through up to parallelism concurrent Range
+// readers of at most chunkSize bytes each, writing every chunk directly
+// into its region of dst, then verifies the result against srcInfo's
+// CRC32C if it carries one, repeating the whole download if
+// verification fails, for at most maxCRCMismatchAttempts attempts in all.
+func downloadInChunks(ctx context.Context, src RangeReader, dst OffsetWriter, srcInfo FileInfo, chunkSize int64, parallelism int, retry RetryPolicy) error {
+	var err error
+	for attempt := 0; attempt < maxCRCMismatchAttempts; attempt++ {
+		err = downloadInChunksOnce(ctx, src, dst, srcInfo, chunkSize, parallelism, retry)
+		var mismatch *crc32CMismatchError
+		if !errors.As(err, &mismatch) {
+			return err
+		}
+	}
+	return err
+}
+
+func downloadInChunksOnce(ctx context.Context, src RangeReader, dst OffsetWriter, srcInfo FileInfo, chunkSize int64, parallelism int, retry RetryPolicy) error {
+	size := srcInfo.Size()
+	if err := dst.Truncate(size); err != nil {
+		return err
+	}
+
+	if size > 0 {
+		sem := make(chan struct{}, parallelism)
+		var wg sync.WaitGroup
+		errs := make(chan error, size/chunkSize+1)
+
+		for offset := int64(0); offset < size; offset += chunkSize {
+			length := chunkSize
+			if offset+length > size {
+				length = size - offset
+			}
+
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(offset, length int64) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				// Each retry attempt opens its own range reader, so a
+				// broken TCP stream only re-reads this chunk rather
+				// than restarting the whole file.
+				err := withRetry(ctx, retry, func(ctx context.Context) error {
+					reader, err := src.NewRangeReader(ctx, offset, length)
+					if err != nil {
+						return err
+					}
+					defer reader.Close()
+
+					w := io.NewOffsetWriter(dst, offset)
+					_, err = io.Copy(w, reader)
+					return err
+				})
+				if err != nil {
+					errs <- err
+				}
+			}(offset, length)
+		}
+
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	crcInfo, ok := srcInfo.(CRC32CInfo)
+	if !ok {
+		return nil
+	}
+	want, ok := crcInfo.CRC32C()
+	if !ok {
+		return nil
+	}
+	got, err := crc32CAt(dst, size)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return &crc32CMismatchError{got: got, want: want}
+	}
+	return nil
+}
+
+// uploadInChunks splits src into at most parallelism concurrent uploads
+// of chunkSize bytes each, so that only a single chunk needs to be
+// re-sent if its upload stream breaks, then calls dst.Finish to stitch
+// the chunks into the final file.
+func uploadInChunks(ctx context.Context, src io.ReaderAt, dst ChunkedWriter, size int64, chunkSize int64, parallelism int, retry RetryPolicy) error {
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	errs := make(chan error, size/chunkSize+1)
+
+	for offset := int64(0); offset < size; offset += chunkSize {
+		length := chunkSize
+		if offset+length > size {
+			length = size - offset
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(offset, length int64) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			// Each retry attempt uploads a fresh section reader, so a
+			// broken resumable session only re-sends this chunk rather
+			// than restarting the whole file.
+			err := withRetry(ctx, retry, func(ctx context.Context) error {
+				r := io.NewSectionReader(src, offset, length)
+				return dst.WriteChunk(ctx, offset, length, r)
+			})
+			if err != nil {
+				errs <- err
+			}
+		}(offset, length)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return withRetry(ctx, retry, dst.Finish)
+}
+
+// crc32CAt streams the first size bytes readable at off=0 through a
+// CRC32C (Castagnoli) hash.
+func crc32CAt(r io.ReaderAt, size int64) (uint32, error) {
+	hasher := crc32.New(crc32CTable)
+	if _, err := io.Copy(hasher, io.NewSectionReader(r, 0, size)); err != nil {
+		return 0, err
+	}
+	return hasher.Sum32(), nil
+}
@@ -0,0 +1,424 @@
+package gcscopy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// GcsFilesystem is a Filesystem backed by a Google Cloud Storage
+// bucket, rooted at Prefix. "Directories" are not real objects: they
+// are synthesized from the common prefixes of the objects that share
+// them, the same convention gsutil and the GCS console use.
+type GcsFilesystem struct {
+	bucket     *storage.BucketHandle
+	bucketName string
+	Prefix     string
+
+	// RewriteStorageClass, if set, is applied as this Filesystem's
+	// destination storage class when it receives a DirectCopier
+	// CopyWithin from another GcsFilesystem, by setting it on the
+	// Copier so GCS issues the rewrite operations needed for a storage
+	// class (or KMS key) change to take effect, rather than a plain
+	// same-class copy.
+	RewriteStorageClass string
+}
+
+// NewGcsFilesystem returns a Filesystem backed by bucket, rooted at
+// prefix.
+func NewGcsFilesystem(client *storage.Client, bucket, prefix string) *GcsFilesystem {
+	return &GcsFilesystem{bucket: client.Bucket(bucket), bucketName: bucket, Prefix: prefix}
+}
+
+func (fs *GcsFilesystem) objectName(name string) string {
+	return Join(fs.Prefix, name)
+}
+
+// Open returns a File that streams the object's content and also
+// implements RangeReader, so Copier can read it as several concurrent
+// chunks.
+func (fs *GcsFilesystem) Open(ctx context.Context, name string) (File, error) {
+	obj := fs.bucket.Object(fs.objectName(name))
+	reader, err := obj.NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &gcsFile{obj: obj, reader: reader}, nil
+}
+
+// Create returns a File that, besides the plain io.Writer path, also
+// implements ChunkedWriter and MetadataReceiver, so Copier can upload
+// it as several concurrent temporary parts, stamp it with preserved
+// metadata, and Compose the parts into the final object.
+func (fs *GcsFilesystem) Create(ctx context.Context, name string) (File, error) {
+	objectName := fs.objectName(name)
+	return &gcsWriterFile{bucket: fs.bucket, obj: fs.bucket.Object(objectName), name: objectName}, nil
+}
+
+func (fs *GcsFilesystem) Stat(ctx context.Context, name string) (FileInfo, error) {
+	objectName := fs.objectName(name)
+	attrs, err := fs.bucket.Object(objectName).Attrs(ctx)
+	if err == nil {
+		return &gcsFileInfo{attrs: attrs}, nil
+	}
+	if err != storage.ErrObjectNotExist {
+		return nil, err
+	}
+
+	// No object has exactly this name: treat it as a synthesized
+	// directory if some object has it as a prefix.
+	it := fs.bucket.Objects(ctx, &storage.Query{Prefix: objectName + "/"})
+	if _, err := it.Next(); err != nil {
+		if err == iterator.Done {
+			return nil, fmt.Errorf(`object "gs://%s/%s" does not exist`, fs.bucketName, objectName)
+		}
+		return nil, err
+	}
+	return &gcsFileInfo{name: objectName, isDir: true}, nil
+}
+
+func (fs *GcsFilesystem) Walk(ctx context.Context, root string, fn WalkFunc) error {
+	prefix := fs.objectName(root)
+	it := fs.bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			if err := fn(root, nil, err); err != nil {
+				return err
+			}
+			continue
+		}
+		relPath, err := Rel(fs.Prefix, attrs.Name)
+		if err != nil {
+			return err
+		}
+		if err := fn(relPath, &gcsFileInfo{attrs: attrs}, nil); err != nil {
+			return err
+		}
+	}
+}
+
+func (fs *GcsFilesystem) Remove(ctx context.Context, name string) error {
+	return fs.bucket.Object(fs.objectName(name)).Delete(ctx)
+}
+
+// Rename has no native GCS equivalent; it is implemented as a copy
+// followed by a delete of the original object.
+func (fs *GcsFilesystem) Rename(ctx context.Context, oldName, newName string) error {
+	src := fs.bucket.Object(fs.objectName(oldName))
+	dst := fs.bucket.Object(fs.objectName(newName))
+	if _, err := dst.CopierFrom(src).Run(ctx); err != nil {
+		return err
+	}
+	return src.Delete(ctx)
+}
+
+// FileCRC32C returns the object's CRC32C as reported by GCS, without
+// downloading its content. It satisfies CRC32CProvider.
+func (fs *GcsFilesystem) FileCRC32C(ctx context.Context, name string) (uint32, error) {
+	attrs, err := fs.bucket.Object(fs.objectName(name)).Attrs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return attrs.CRC32C, nil
+}
+
+// CopyWithin copies srcName to dstName using the GCS Copy/Rewrite API
+// directly, without the object's bytes passing through this process.
+// It only handles the case where dst is also a GcsFilesystem;
+// otherwise it reports handled=false so the caller falls back to
+// Open/Create. GCS preserves the source object's metadata and ACLs
+// across the copy unless dst.RewriteStorageClass requests a storage
+// class change, in which case it is applied on the Copier so GCS
+// issues the rewrite needed for the change to take effect.
+func (fs *GcsFilesystem) CopyWithin(ctx context.Context, dst Filesystem, srcName, dstName string) (handled bool, err error) {
+	dstGcs, ok := dst.(*GcsFilesystem)
+	if !ok {
+		return false, nil
+	}
+	srcObj := fs.bucket.Object(fs.objectName(srcName))
+	dstObj := dstGcs.bucket.Object(dstGcs.objectName(dstName))
+
+	copier := dstObj.CopierFrom(srcObj)
+	if dstGcs.RewriteStorageClass != "" {
+		copier.StorageClass = dstGcs.RewriteStorageClass
+	}
+	if _, err := copier.Run(ctx); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// gcsFileInfo is the FileInfo for a GCS object or synthesized
+// "directory".
+type gcsFileInfo struct {
+	attrs *storage.ObjectAttrs
+	name  string
+	isDir bool
+}
+
+func (i *gcsFileInfo) Name() string {
+	if i.attrs != nil {
+		return i.attrs.Name
+	}
+	return i.name
+}
+
+func (i *gcsFileInfo) Size() int64 {
+	if i.attrs == nil {
+		return 0
+	}
+	return i.attrs.Size
+}
+
+func (i *gcsFileInfo) IsDir() bool {
+	if i.attrs != nil {
+		return strings.HasSuffix(i.attrs.Name, "/")
+	}
+	return i.isDir
+}
+
+// CRC32C returns the object's CRC32C (Castagnoli) checksum, as reported
+// by GCS. It satisfies CRC32CInfo.
+func (i *gcsFileInfo) CRC32C() (uint32, bool) {
+	if i.attrs == nil {
+		return 0, false
+	}
+	return i.attrs.CRC32C, true
+}
+
+// Metadata returns the object's preservable attributes. It satisfies
+// MetadataInfo.
+func (i *gcsFileInfo) Metadata() Metadata {
+	if i.attrs == nil {
+		return Metadata{}
+	}
+	md := Metadata{
+		ContentType:        i.attrs.ContentType,
+		ContentEncoding:    i.attrs.ContentEncoding,
+		CacheControl:       i.attrs.CacheControl,
+		ContentDisposition: i.attrs.ContentDisposition,
+		Metadata:           i.attrs.Metadata,
+		StorageClass:       i.attrs.StorageClass,
+	}
+	for _, rule := range i.attrs.ACL {
+		md.ACL = append(md.ACL, ACLRule{Entity: string(rule.Entity), Role: string(rule.Role)})
+	}
+	return md
+}
+
+// gcsFile wraps a storage.Reader for the Open path. It also implements
+// RangeReader so Copier can read it as several concurrent chunks.
+type gcsFile struct {
+	obj    *storage.ObjectHandle
+	reader *storage.Reader
+}
+
+func (f *gcsFile) Read(p []byte) (int, error) { return f.reader.Read(p) }
+
+func (f *gcsFile) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("gcscopy: a file opened for reading cannot be written to")
+}
+
+func (f *gcsFile) Close() error { return f.reader.Close() }
+
+func (f *gcsFile) NewRangeReader(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	return f.obj.NewRangeReader(ctx, offset, length)
+}
+
+// gcsWriterFile wraps a storage.Writer for the Create path. It also
+// implements ChunkedWriter: WriteChunk uploads each chunk to its own
+// temporary part object, and Finish composes the parts into obj and
+// deletes them. SetMetadata stamps any preserved Metadata onto the
+// object before it is written or composed.
+type gcsWriterFile struct {
+	bucket *storage.BucketHandle
+	obj    *storage.ObjectHandle
+	name   string
+
+	writer      *storage.Writer
+	metadata    Metadata
+	hasMetadata bool
+
+	mu       sync.Mutex
+	parts    map[int64]*storage.ObjectHandle
+	finished bool
+}
+
+// SetMetadata records md to be applied to the object before it is
+// finalized. It satisfies MetadataReceiver.
+func (f *gcsWriterFile) SetMetadata(md Metadata) {
+	f.metadata = md
+	f.hasMetadata = true
+}
+
+func (f *gcsWriterFile) Read(p []byte) (int, error) {
+	return 0, fmt.Errorf("gcscopy: a file opened for writing cannot be read from")
+}
+
+func (f *gcsWriterFile) Write(p []byte) (int, error) {
+	if f.writer == nil {
+		f.writer = f.obj.NewWriter(context.Background())
+		applyMetadata(&f.writer.ObjectAttrs, f.metadata, f.hasMetadata)
+	}
+	return f.writer.Write(p)
+}
+
+func (f *gcsWriterFile) Close() error {
+	if f.finished {
+		return nil
+	}
+	if f.writer == nil {
+		if f.parts != nil {
+			// A chunked upload started but the caller is closing without
+			// ever reaching Finish, e.g. because a WriteChunk failed:
+			// the destination object was never touched, so leave it
+			// alone rather than overwriting it with an empty object, and
+			// clean up the parts that did make it up.
+			f.mu.Lock()
+			parts := make([]*storage.ObjectHandle, 0, len(f.parts))
+			for _, part := range f.parts {
+				parts = append(parts, part)
+			}
+			f.mu.Unlock()
+			deleteAll(context.Background(), parts)
+			return fmt.Errorf("gcscopy: chunked upload to %q closed before Finish", f.name)
+		}
+		// Write was never called, e.g. for a zero-length file copied via
+		// the plain io.Copy path: open the writer here so Close still
+		// creates the (empty) object instead of silently creating
+		// nothing.
+		f.writer = f.obj.NewWriter(context.Background())
+		applyMetadata(&f.writer.ObjectAttrs, f.metadata, f.hasMetadata)
+	}
+	return f.writer.Close()
+}
+
+func (f *gcsWriterFile) WriteChunk(ctx context.Context, offset, length int64, r io.Reader) error {
+	partObj := f.bucket.Object(fmt.Sprintf("%s.part-%020d", f.name, offset))
+	w := partObj.NewWriter(ctx)
+	if _, err := io.CopyN(w, r, length); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	if f.parts == nil {
+		f.parts = map[int64]*storage.ObjectHandle{}
+	}
+	f.parts[offset] = partObj
+	f.mu.Unlock()
+	return nil
+}
+
+// maxComposeSources is the largest number of source objects the GCS
+// Compose API accepts in a single request.
+const maxComposeSources = 32
+
+func (f *gcsWriterFile) Finish(ctx context.Context) error {
+	offsets := make([]int64, 0, len(f.parts))
+	for offset := range f.parts {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	parts := make([]*storage.ObjectHandle, len(offsets))
+	for i, offset := range offsets {
+		parts[i] = f.parts[offset]
+	}
+
+	intermediates, err := f.composeTiered(ctx, parts)
+	temp := append(append([]*storage.ObjectHandle{}, parts...), intermediates...)
+	if err != nil {
+		// Best-effort: a file over the Compose limit that fails partway
+		// through leaves no composed object behind, so there is nothing
+		// to prefer over cleaning up every temporary object it made.
+		deleteAll(ctx, temp)
+		return err
+	}
+	if err := deleteAll(ctx, temp); err != nil {
+		return err
+	}
+	f.finished = true
+	return nil
+}
+
+// composeTiered composes srcs into f.obj, stamped with f.metadata. GCS
+// Compose accepts at most maxComposeSources objects per request, so
+// srcs over that limit are first reduced to a handful of intermediate
+// "tier" objects, each itself the Compose of up to maxComposeSources
+// srcs, repeating until one Compose call into f.obj suffices. It
+// returns every intermediate object it created, so the caller can clean
+// them up alongside the original parts whether or not Finish succeeds.
+func (f *gcsWriterFile) composeTiered(ctx context.Context, srcs []*storage.ObjectHandle) ([]*storage.ObjectHandle, error) {
+	var intermediates []*storage.ObjectHandle
+	for tier := 0; len(srcs) > maxComposeSources; tier++ {
+		var next []*storage.ObjectHandle
+		for i := 0; i < len(srcs); i += maxComposeSources {
+			end := i + maxComposeSources
+			if end > len(srcs) {
+				end = len(srcs)
+			}
+			tierObj := f.bucket.Object(fmt.Sprintf("%s.tier-%d-%020d", f.name, tier, i))
+			if _, err := tierObj.ComposerFrom(srcs[i:end]...).Run(ctx); err != nil {
+				return intermediates, err
+			}
+			intermediates = append(intermediates, tierObj)
+			next = append(next, tierObj)
+		}
+		srcs = next
+	}
+
+	composer := f.obj.ComposerFrom(srcs...)
+	applyMetadata(&composer.ObjectAttrs, f.metadata, f.hasMetadata)
+	if _, err := composer.Run(ctx); err != nil {
+		return intermediates, err
+	}
+	return intermediates, nil
+}
+
+// deleteAll deletes every object in objs, continuing past individual
+// failures so one missing object doesn't strand the rest, and returns
+// the first error encountered, if any.
+func deleteAll(ctx context.Context, objs []*storage.ObjectHandle) error {
+	var firstErr error
+	for _, obj := range objs {
+		if err := obj.Delete(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// applyMetadata copies md's fields onto attrs, if has is set.
+func applyMetadata(attrs *storage.ObjectAttrs, md Metadata, has bool) {
+	if !has {
+		return
+	}
+	attrs.ContentType = md.ContentType
+	attrs.ContentEncoding = md.ContentEncoding
+	attrs.CacheControl = md.CacheControl
+	attrs.ContentDisposition = md.ContentDisposition
+	attrs.Metadata = md.Metadata
+	attrs.StorageClass = md.StorageClass
+	if len(md.ACL) == 0 {
+		return
+	}
+	acl := make([]storage.ACLRule, len(md.ACL))
+	for i, rule := range md.ACL {
+		acl[i] = storage.ACLRule{Entity: storage.ACLEntity(rule.Entity), Role: storage.ACLRole(rule.Role)}
+	}
+	attrs.ACL = acl
+}
@@ -0,0 +1,146 @@
+package gcscopy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+// fakeGcsServer is a minimal JSON API stand-in for the handful of
+// requests gcsWriterFile issues: Compose and Delete. Any other request
+// fails the test loudly instead of silently succeeding.
+type fakeGcsServer struct {
+	t          *testing.T
+	srv        *httptest.Server
+	failObject string // compose into this object name returns an error
+
+	mu       sync.Mutex
+	deleted  []string
+	composed []string
+}
+
+func newFakeGcsServer(t *testing.T, failObject string) *fakeGcsServer {
+	f := &fakeGcsServer{t: t, failObject: failObject}
+	f.srv = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func (f *fakeGcsServer) handle(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodDelete && strings.Contains(r.URL.Path, "/o/"):
+		object := r.URL.Path[strings.LastIndex(r.URL.Path, "/o/")+len("/o/"):]
+		f.mu.Lock()
+		f.deleted = append(f.deleted, object)
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/compose"):
+		object := strings.TrimSuffix(r.URL.Path[strings.LastIndex(r.URL.Path, "/o/")+len("/o/"):], "/compose")
+		if f.failObject != "" && strings.Contains(object, f.failObject) {
+			http.Error(w, "compose failed", http.StatusInternalServerError)
+			return
+		}
+		f.mu.Lock()
+		f.composed = append(f.composed, object)
+		f.mu.Unlock()
+		fmt.Fprintf(w, `{"kind":"storage#object","bucket":"bucket","name":%q}`, object)
+
+	default:
+		f.t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		http.Error(w, "unexpected request", http.StatusNotImplemented)
+	}
+}
+
+func (f *fakeGcsServer) client(t *testing.T) *storage.Client {
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx, option.WithEndpoint(f.srv.URL), option.WithoutAuthentication(), option.WithHTTPClient(f.srv.Client()))
+	if err != nil {
+		t.Fatalf("storage.NewClient: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestGcsWriterFile_CloseBeforeFinish_AbortsWithoutOverwritingDestination(t *testing.T) {
+	fake := newFakeGcsServer(t, "")
+	bucket := fake.client(t).Bucket("bucket")
+
+	f := &gcsWriterFile{
+		bucket: bucket,
+		obj:    bucket.Object("dest"),
+		name:   "dest",
+		parts: map[int64]*storage.ObjectHandle{
+			0: bucket.Object("dest.part-0"),
+			1: bucket.Object("dest.part-1"),
+		},
+	}
+
+	if err := f.Close(); err == nil {
+		t.Fatal("Close before Finish: got nil error, want one reporting the aborted upload")
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.composed) != 0 {
+		t.Fatalf("destination was composed/overwritten: %v", fake.composed)
+	}
+	want := map[string]bool{"dest.part-0": true, "dest.part-1": true}
+	if len(fake.deleted) != len(want) {
+		t.Fatalf("deleted = %v, want parts %v cleaned up", fake.deleted, want)
+	}
+	for _, name := range fake.deleted {
+		if !want[name] {
+			t.Errorf("unexpected object deleted: %s", name)
+		}
+	}
+}
+
+func TestGcsWriterFile_Finish_TiersComposesAndCleansUpOnFailure(t *testing.T) {
+	const numParts = 40 // over maxComposeSources, forces a tiered compose
+	const failingTier = "dest.tier-0-00000000000000000032"
+
+	fake := newFakeGcsServer(t, failingTier)
+	bucket := fake.client(t).Bucket("bucket")
+
+	f := &gcsWriterFile{
+		bucket: bucket,
+		obj:    bucket.Object("dest"),
+		name:   "dest",
+		parts:  map[int64]*storage.ObjectHandle{},
+	}
+	for i := int64(0); i < numParts; i++ {
+		f.parts[i] = bucket.Object(fmt.Sprintf("dest.part-%020d", i))
+	}
+
+	if err := f.Finish(context.Background()); err == nil {
+		t.Fatal("Finish with a failing tier compose: got nil error, want one")
+	}
+	if f.finished {
+		t.Fatal("Finish left f.finished set to true after a failure")
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.composed) == 0 {
+		t.Fatal("expected at least the successful first tier to have been composed")
+	}
+	for _, name := range fake.composed {
+		if strings.Contains(name, "00000000000000000032") {
+			t.Fatalf("the failing compose was recorded as succeeding: %v", fake.composed)
+		}
+	}
+	// Every original part plus every tier object that did get composed
+	// must be cleaned up, whether or not Finish ultimately succeeded.
+	wantDeleted := numParts + len(fake.composed)
+	if len(fake.deleted) != wantDeleted {
+		t.Fatalf("deleted %d temp objects, want %d (parts=%d + intermediates=%d): %v", len(fake.deleted), wantDeleted, numParts, len(fake.composed), fake.deleted)
+	}
+}
@@ -0,0 +1,451 @@
+//  Copyright 2020 Alexey Volkov
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package gcscopy implements the file-copying logic behind the gcs_copy_go
+// command as a reusable library. A Copier moves files and directory trees
+// between two Filesystem implementations, one of which is typically a
+// GcsFilesystem (Google Cloud Storage) and the other a LocalFilesystem, so the
+// same code path handles GCS-to-local, local-to-GCS and GCS-to-GCS
+// transfers.
+package gcscopy
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// FileInfo describes a file or directory on either side of a copy. It is
+// intentionally satisfied by os.FileInfo so LocalFilesystem can return
+// os.Stat results unchanged.
+type FileInfo interface {
+	Name() string
+	Size() int64
+	IsDir() bool
+}
+
+// File is an open file handle on either side of a copy.
+type File interface {
+	io.ReadWriteCloser
+}
+
+// WalkFunc is called once per entry encountered while walking a tree,
+// mirroring filepath.WalkFunc.
+type WalkFunc func(path string, info FileInfo, err error) error
+
+// Filesystem abstracts the operations Copier needs from either the local
+// disk or a GCS bucket, so the copy logic does not need to know which
+// backend it is talking to. Paths are always relative to whatever root
+// (local directory or "gs://bucket/prefix") the Filesystem was created
+// for.
+type Filesystem interface {
+	Open(ctx context.Context, name string) (File, error)
+	Create(ctx context.Context, name string) (File, error)
+	Stat(ctx context.Context, name string) (FileInfo, error)
+	Walk(ctx context.Context, root string, fn WalkFunc) error
+	Remove(ctx context.Context, name string) error
+	Rename(ctx context.Context, oldName, newName string) error
+}
+
+// RangeReader is implemented by File values that can serve independent,
+// concurrently-readable byte ranges, such as GCS objects. Copier uses it
+// to download a file as several chunks in parallel.
+type RangeReader interface {
+	NewRangeReader(ctx context.Context, offset, length int64) (io.ReadCloser, error)
+}
+
+// OffsetWriter is implemented by File values that can be written at
+// arbitrary, independently-addressable offsets, such as a pre-allocated
+// local file. Copier uses it as the other half of a parallel download.
+type OffsetWriter interface {
+	io.WriterAt
+	io.ReaderAt
+	Truncate(size int64) error
+}
+
+// ChunkedWriter is implemented by File values that accept a file's
+// content as several independently-uploaded chunks which are stitched
+// together on Finish, such as a GCS object backed by temporary parts and
+// a Compose call. Copier uses it as the other half of a parallel upload.
+type ChunkedWriter interface {
+	WriteChunk(ctx context.Context, offset, length int64, r io.Reader) error
+	Finish(ctx context.Context) error
+}
+
+// CRC32CInfo is implemented by FileInfo values that carry a known
+// CRC32C (Castagnoli) checksum, such as a GCS object's attrs.
+type CRC32CInfo interface {
+	CRC32C() (sum uint32, ok bool)
+}
+
+// CRC32CProvider is implemented by a Filesystem that has a cheaper way
+// to obtain a file's CRC32C than streaming its whole content through a
+// hasher, such as LocalFilesystem's sidecar cache.
+type CRC32CProvider interface {
+	FileCRC32C(ctx context.Context, name string) (uint32, error)
+}
+
+// DirectCopier is implemented by a Filesystem that can copy an object
+// directly to another Filesystem of the same backend without the data
+// passing through this process, such as the GCS Copy/Rewrite APIs.
+// CopyWithin returns handled=false if dst is not a Filesystem it knows
+// how to copy to directly, so the caller can fall back to Open/Create.
+type DirectCopier interface {
+	CopyWithin(ctx context.Context, dst Filesystem, srcName, dstName string) (handled bool, err error)
+}
+
+// Copier copies files and directory trees between a source and a
+// destination Filesystem.
+type Copier struct {
+	SrcFs Filesystem
+	DstFs Filesystem
+
+	// Parallelism is the number of chunks transferred concurrently when
+	// a file is large enough to be split. It defaults to
+	// DefaultParallelism when zero.
+	Parallelism int
+	// ChunkSize is the size in bytes of each transfer chunk. It
+	// defaults to DefaultChunkSize when zero.
+	ChunkSize int64
+
+	// Pattern, if set, restricts CopyTree to entries whose path
+	// relative to the tree's src root matches it, per MatchGlob. An
+	// empty Pattern copies everything.
+	Pattern string
+
+	// Retry controls how failed chunks, whole-file direct copies, and
+	// plain streaming copies are retried.
+	Retry RetryPolicy
+
+	// PreserveMetadata, if set, carries ContentType, ContentEncoding,
+	// CacheControl, ContentDisposition, custom Metadata, storage class
+	// and ACLs across the copy: applied directly when dst supports
+	// MetadataReceiver, or via dst's metadata sidecar otherwise.
+	PreserveMetadata bool
+}
+
+// NewCopier returns a Copier that copies between srcFs and dstFs using
+// the default parallelism and chunk size.
+func NewCopier(srcFs, dstFs Filesystem) *Copier {
+	return &Copier{
+		SrcFs:       srcFs,
+		DstFs:       dstFs,
+		Parallelism: DefaultParallelism,
+		ChunkSize:   DefaultChunkSize,
+	}
+}
+
+// CopyFile copies the single file at src (relative to c.SrcFs) to dst
+// (relative to c.DstFs).
+func (c *Copier) CopyFile(ctx context.Context, src, dst string) error {
+	if dc, ok := c.SrcFs.(DirectCopier); ok {
+		handled := false
+		err := withRetry(ctx, c.Retry, func(ctx context.Context) error {
+			var err error
+			handled, err = dc.CopyWithin(ctx, c.DstFs, src, dst)
+			return err
+		})
+		if handled {
+			return err
+		}
+	}
+
+	srcInfo, err := c.SrcFs.Stat(ctx, src)
+	if err != nil {
+		return err
+	}
+
+	srcFile, err := c.SrcFs.Open(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := c.DstFs.Create(ctx, dst)
+	if err != nil {
+		return err
+	}
+
+	if c.PreserveMetadata {
+		if err := c.preserveMetadata(ctx, src, srcInfo, dst, dstFile); err != nil {
+			dstFile.Close()
+			return err
+		}
+	}
+
+	if err := c.copyFileContents(ctx, srcFile, dstFile, srcInfo); err != nil {
+		dstFile.Close()
+		return err
+	}
+	return dstFile.Close()
+}
+
+// preserveMetadata carries src's Metadata, if any, over to dst: applied
+// directly if dstFile accepts it, and written to dst's metadata
+// sidecar otherwise.
+func (c *Copier) preserveMetadata(ctx context.Context, src string, srcInfo FileInfo, dst string, dstFile File) error {
+	md, ok, err := sourceMetadata(ctx, c.SrcFs, src, srcInfo)
+	if err != nil || !ok {
+		return err
+	}
+	if mr, ok := dstFile.(MetadataReceiver); ok {
+		mr.SetMetadata(md)
+		return nil
+	}
+	if sp, ok := c.DstFs.(MetadataSidecarProvider); ok {
+		return sp.WriteMetadataSidecar(ctx, dst, md)
+	}
+	return nil
+}
+
+// copyFileContents picks the fastest available strategy for moving
+// size bytes from src to dst: a parallel chunked download, a parallel
+// chunked upload, or a plain streaming copy.
+func (c *Copier) copyFileContents(ctx context.Context, src File, dst File, srcInfo FileInfo) error {
+	parallelism := c.Parallelism
+	if parallelism <= 0 {
+		parallelism = DefaultParallelism
+	}
+	chunkSize := c.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	if rr, ok := src.(RangeReader); ok {
+		if ow, ok := dst.(OffsetWriter); ok {
+			return downloadInChunks(ctx, rr, ow, srcInfo, chunkSize, parallelism, c.Retry)
+		}
+	}
+	if cw, ok := dst.(ChunkedWriter); ok {
+		if ra, ok := src.(io.ReaderAt); ok && srcInfo.Size() > 0 {
+			return uploadInChunks(ctx, ra, cw, srcInfo.Size(), chunkSize, parallelism, c.Retry)
+		}
+	}
+
+	return withRetry(ctx, c.Retry, func(ctx context.Context) error {
+		_, err := io.Copy(dst, src)
+		return err
+	})
+}
+
+// FileError associates a per-file error with the path that failed, so
+// CopyTree and Sync can report which files failed without aborting the
+// rest of the tree.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string { return fmt.Sprintf("%s: %v", e.Path, e.Err) }
+func (e *FileError) Unwrap() error { return e.Err }
+
+// CopyTree copies every regular file under src (relative to c.SrcFs) to
+// the corresponding path under dst (relative to c.DstFs). A failure to
+// copy one file does not stop the rest of the tree from being
+// attempted; every such failure is returned as a *FileError in errs. err
+// is non-nil only for a structural failure of the walk itself, such as
+// being unable to list src.
+func (c *Copier) CopyTree(ctx context.Context, src, dst string) (errs []*FileError, err error) {
+	err = c.SrcFs.Walk(ctx, src, func(path string, info FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relPath, err := Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if c.Pattern != "" {
+			matched, err := MatchGlob(c.Pattern, relPath)
+			if err != nil {
+				return err
+			}
+			if !matched {
+				return nil
+			}
+		}
+		if err := c.CopyFile(ctx, path, Join(dst, relPath)); err != nil {
+			errs = append(errs, &FileError{Path: path, Err: err})
+		}
+		return nil
+	})
+	return errs, err
+}
+
+// SyncResult summarizes the files a Sync call copied, skipped because
+// they already matched, and (if deleteExtraneous was set) deleted.
+type SyncResult struct {
+	Copied  []string
+	Skipped []string
+	Deleted []string
+	// Errors holds a *FileError for every file that failed to copy or
+	// be removed; Sync keeps going after each one.
+	Errors []*FileError
+}
+
+// Sync makes the tree at dst (relative to c.DstFs) match the tree at
+// src (relative to c.SrcFs): files missing from dst or differing in
+// size or CRC32C are copied, files that already match are skipped, and,
+// if deleteExtraneous is set, files present under dst but not under src
+// are removed. A failure to copy or remove one file does not stop the
+// rest of the tree from being attempted; every such failure is returned
+// as a *FileError in the result's Errors field. The returned error is
+// non-nil only for a structural failure, such as being unable to list
+// src or dst.
+func (c *Copier) Sync(ctx context.Context, src, dst string, deleteExtraneous bool) (*SyncResult, error) {
+	result := &SyncResult{}
+
+	dstEntries := map[string]FileInfo{}
+	err := c.DstFs.Walk(ctx, dst, func(path string, info FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relPath, err := Rel(dst, path)
+		if err != nil {
+			return err
+		}
+		dstEntries[relPath] = info
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	err = c.SrcFs.Walk(ctx, src, func(path string, info FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relPath, err := Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if c.Pattern != "" {
+			matched, err := MatchGlob(c.Pattern, relPath)
+			if err != nil {
+				return err
+			}
+			if !matched {
+				return nil
+			}
+		}
+		seen[relPath] = true
+
+		dstPath := Join(dst, relPath)
+		if dstInfo, ok := dstEntries[relPath]; ok {
+			same, err := c.unchanged(ctx, path, info, dstPath, dstInfo)
+			if err != nil {
+				return err
+			}
+			if same {
+				result.Skipped = append(result.Skipped, relPath)
+				return nil
+			}
+		}
+
+		if err := c.CopyFile(ctx, path, dstPath); err != nil {
+			result.Errors = append(result.Errors, &FileError{Path: path, Err: err})
+			return nil
+		}
+		result.Copied = append(result.Copied, relPath)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if deleteExtraneous {
+		for relPath := range dstEntries {
+			if seen[relPath] {
+				continue
+			}
+			if c.Pattern != "" {
+				matched, err := MatchGlob(c.Pattern, relPath)
+				if err != nil {
+					return nil, err
+				}
+				if !matched {
+					// Out of this sync's scope: never a candidate to be
+					// produced by it, so it must not be treated as
+					// extraneous either.
+					continue
+				}
+			}
+			dstPath := Join(dst, relPath)
+			if err := c.DstFs.Remove(ctx, dstPath); err != nil {
+				result.Errors = append(result.Errors, &FileError{Path: dstPath, Err: err})
+				continue
+			}
+			result.Deleted = append(result.Deleted, relPath)
+		}
+	}
+
+	return result, nil
+}
+
+// unchanged reports whether dstPath already matches srcPath's size and
+// CRC32C, so Sync can skip re-copying it.
+func (c *Copier) unchanged(ctx context.Context, srcPath string, srcInfo FileInfo, dstPath string, dstInfo FileInfo) (bool, error) {
+	if srcInfo.Size() != dstInfo.Size() {
+		return false, nil
+	}
+	srcSum, err := fileCRC32C(ctx, c.SrcFs, srcPath, srcInfo)
+	if err != nil {
+		return false, err
+	}
+	dstSum, err := fileCRC32C(ctx, c.DstFs, dstPath, dstInfo)
+	if err != nil {
+		return false, err
+	}
+	return srcSum == dstSum, nil
+}
+
+// fileCRC32C returns name's CRC32C, preferring a checksum already
+// carried by info, then a Filesystem-specific cache, and falling back
+// to streaming the file through a hasher.
+func fileCRC32C(ctx context.Context, fs Filesystem, name string, info FileInfo) (uint32, error) {
+	if crcInfo, ok := info.(CRC32CInfo); ok {
+		if sum, ok := crcInfo.CRC32C(); ok {
+			return sum, nil
+		}
+	}
+	if p, ok := fs.(CRC32CProvider); ok {
+		return p.FileCRC32C(ctx, name)
+	}
+
+	f, err := fs.Open(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	hasher := crc32.New(crc32CTable)
+	if _, err := io.Copy(hasher, f); err != nil {
+		return 0, err
+	}
+	return hasher.Sum32(), nil
+}
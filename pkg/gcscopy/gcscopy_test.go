@@ -0,0 +1,59 @@
+package gcscopy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSync_DeleteExtraneous_RespectsPattern(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+
+	// dst has one file that is in this sync's scope but no longer in
+	// src (genuinely extraneous) and one file outside the sync's
+	// Pattern entirely, which must survive.
+	writeFile(t, dstDir, "in-scope-stale.json", "stale")
+	writeFile(t, dstDir, "out-of-scope.txt", "unrelated")
+
+	c := &Copier{
+		SrcFs:   NewLocalFilesystem(srcDir),
+		DstFs:   NewLocalFilesystem(dstDir),
+		Pattern: "*.json",
+	}
+
+	result, err := c.Sync(context.Background(), "", "", true)
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	if !contains(result.Deleted, "in-scope-stale.json") {
+		t.Errorf("Deleted = %v, want it to include the stale in-scope file", result.Deleted)
+	}
+	if contains(result.Deleted, "out-of-scope.txt") {
+		t.Errorf("Deleted = %v, want it to exclude the out-of-pattern file", result.Deleted)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "out-of-scope.txt")); err != nil {
+		t.Errorf("out-of-scope.txt was removed from disk even though it is outside Pattern: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "in-scope-stale.json")); !os.IsNotExist(err) {
+		t.Errorf("in-scope-stale.json still exists on disk, want it deleted")
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0666); err != nil {
+		t.Fatalf("writeFile(%s): %v", name, err)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
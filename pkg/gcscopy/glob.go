@@ -0,0 +1,69 @@
+package gcscopy
+
+import (
+	"path"
+	"strings"
+)
+
+// SplitGlobPrefix splits pattern into the longest literal, non-wildcard
+// directory prefix and the remaining pattern relative to it. Callers
+// use prefix to construct or scope a Filesystem so only that subtree is
+// listed, then match each entry's path (relative to prefix) against
+// rest with MatchGlob.
+func SplitGlobPrefix(pattern string) (prefix, rest string) {
+	if !hasMeta(pattern) {
+		return pattern, ""
+	}
+
+	cut := strings.IndexAny(pattern, "*?[")
+	literal := pattern[:cut]
+	slash := strings.LastIndex(literal, "/")
+	if slash < 0 {
+		return "", pattern
+	}
+	return literal[:slash], pattern[slash+1:]
+}
+
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// MatchGlob reports whether name matches pattern. It extends
+// path.Match with "**" path segments, which match any number of path
+// segments (including none), so patterns like "logs/2024-*/**/*.json"
+// can match at any depth.
+func MatchGlob(pattern, name string) (bool, error) {
+	return matchGlobParts(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobParts(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return true, nil
+			}
+			for i := 0; i <= len(name); i++ {
+				ok, err := matchGlobParts(pattern[1:], name[i:])
+				if err != nil {
+					return false, err
+				}
+				if ok {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+		if len(name) == 0 {
+			return false, nil
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0, nil
+}
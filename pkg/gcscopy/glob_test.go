@@ -0,0 +1,51 @@
+package gcscopy
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.json", "a.json", true},
+		{"*.json", "a.txt", false},
+		{"logs/*.json", "logs/a.json", true},
+		{"logs/*.json", "logs/sub/a.json", false},
+		{"logs/**/*.json", "logs/a.json", true},
+		{"logs/**/*.json", "logs/sub/a.json", true},
+		{"logs/**/*.json", "logs/sub/sub2/a.json", true},
+		{"logs/**/*.json", "other/a.json", false},
+		{"logs/2024-*/**/*.json", "logs/2024-01/day1/a.json", true},
+		{"logs/2024-*/**/*.json", "logs/2023-01/day1/a.json", false},
+		{"**", "anything/at/all", true},
+		{"a/b", "a/b", true},
+		{"a/b", "a/b/c", false},
+	}
+	for _, c := range cases {
+		got, err := MatchGlob(c.pattern, c.name)
+		if err != nil {
+			t.Errorf("MatchGlob(%q, %q): %v", c.pattern, c.name, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("MatchGlob(%q, %q) = %v, want %v", c.pattern, c.name, got, c.want)
+		}
+	}
+}
+
+func TestSplitGlobPrefix(t *testing.T) {
+	cases := []struct {
+		pattern, wantPrefix, wantRest string
+	}{
+		{"logs/2024-01/a.json", "logs/2024-01/a.json", ""},
+		{"logs/2024-*/a.json", "logs", "2024-*/a.json"},
+		{"logs/2024-*/**/*.json", "logs", "2024-*/**/*.json"},
+		{"*.json", "", "*.json"},
+	}
+	for _, c := range cases {
+		prefix, rest := SplitGlobPrefix(c.pattern)
+		if prefix != c.wantPrefix || rest != c.wantRest {
+			t.Errorf("SplitGlobPrefix(%q) = (%q, %q), want (%q, %q)", c.pattern, prefix, rest, c.wantPrefix, c.wantRest)
+		}
+	}
+}
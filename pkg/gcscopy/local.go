@@ -0,0 +1,170 @@
+package gcscopy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// crc32CSidecarSuffix names the file that caches a local file's
+	// CRC32C next to it, so repeated Sync runs don't re-hash unchanged
+	// files.
+	crc32CSidecarSuffix = ".crc32c"
+	// metadataSidecarSuffix names the file that carries a copied
+	// object's Metadata next to a local file, since the local
+	// filesystem has nowhere else to store it.
+	metadataSidecarSuffix = ".metadata.json"
+)
+
+// LocalFilesystem is a Filesystem backed by the local disk, rooted at
+// Root. Paths passed to its methods are slash-separated and relative to
+// Root, matching the convention Copier uses for GcsFilesystem paths.
+type LocalFilesystem struct {
+	Root string
+}
+
+// NewLocalFilesystem returns a Filesystem rooted at root.
+func NewLocalFilesystem(root string) *LocalFilesystem {
+	return &LocalFilesystem{Root: root}
+}
+
+func (fs *LocalFilesystem) nativePath(name string) string {
+	return filepath.Join(fs.Root, filepath.FromSlash(name))
+}
+
+// Open opens the file at name for reading. The returned File is an
+// *os.File, which also implements io.ReaderAt so it can serve as the
+// source half of a parallel chunked upload.
+func (fs *LocalFilesystem) Open(ctx context.Context, name string) (File, error) {
+	return os.Open(fs.nativePath(name))
+}
+
+// Create truncates or creates the file at name for writing, creating
+// any missing parent directories. The returned File is an *os.File,
+// which also implements OffsetWriter so it can serve as the destination
+// half of a parallel chunked download.
+func (fs *LocalFilesystem) Create(ctx context.Context, name string) (File, error) {
+	nativePath := fs.nativePath(name)
+	if err := os.MkdirAll(filepath.Dir(nativePath), os.ModePerm); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(nativePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// Stat returns the os.FileInfo for name, which satisfies FileInfo.
+func (fs *LocalFilesystem) Stat(ctx context.Context, name string) (FileInfo, error) {
+	return os.Stat(fs.nativePath(name))
+}
+
+// Walk calls fn once for every entry under root (a slash-separated path
+// relative to fs.Root), with the path argument passed to fn also
+// slash-separated and relative to fs.Root. The ".crc32c" and
+// ".metadata.json" sidecar files are skipped.
+func (fs *LocalFilesystem) Walk(ctx context.Context, root string, fn WalkFunc) error {
+	nativeRoot := fs.nativePath(root)
+	return filepath.Walk(nativeRoot, func(nativePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fn(root, nil, err)
+		}
+		if !info.IsDir() && (strings.HasSuffix(nativePath, crc32CSidecarSuffix) || strings.HasSuffix(nativePath, metadataSidecarSuffix)) {
+			return nil
+		}
+		relPath, err := filepath.Rel(fs.Root, nativePath)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			relPath = ""
+		}
+		return fn(filepath.ToSlash(relPath), info, nil)
+	})
+}
+
+// Remove deletes the file at name.
+func (fs *LocalFilesystem) Remove(ctx context.Context, name string) error {
+	return os.Remove(fs.nativePath(name))
+}
+
+// Rename moves the file at oldName to newName, creating any missing
+// parent directories for newName.
+func (fs *LocalFilesystem) Rename(ctx context.Context, oldName, newName string) error {
+	newNativePath := fs.nativePath(newName)
+	if err := os.MkdirAll(filepath.Dir(newNativePath), os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(fs.nativePath(oldName), newNativePath)
+}
+
+// FileCRC32C returns name's CRC32C (Castagnoli), reading it from a
+// "<file>.crc32c" sidecar when that sidecar is newer than the file, and
+// otherwise computing it by streaming the file through a hasher and
+// writing the sidecar for next time. It satisfies CRC32CProvider.
+func (fs *LocalFilesystem) FileCRC32C(ctx context.Context, name string) (uint32, error) {
+	nativePath := fs.nativePath(name)
+	sidecarPath := nativePath + crc32CSidecarSuffix
+
+	info, err := os.Stat(nativePath)
+	if err != nil {
+		return 0, err
+	}
+
+	if sidecarInfo, err := os.Stat(sidecarPath); err == nil && sidecarInfo.ModTime().After(info.ModTime()) {
+		if data, err := os.ReadFile(sidecarPath); err == nil {
+			if sum, err := strconv.ParseUint(strings.TrimSpace(string(data)), 16, 32); err == nil {
+				return uint32(sum), nil
+			}
+		}
+	}
+
+	f, err := os.Open(nativePath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	hasher := crc32.New(crc32CTable)
+	if _, err := io.Copy(hasher, f); err != nil {
+		return 0, err
+	}
+	sum := hasher.Sum32()
+
+	// Best-effort: a failure to cache the checksum should not fail the
+	// caller, which already has the value it needed.
+	_ = os.WriteFile(sidecarPath, []byte(fmt.Sprintf("%08x", sum)), 0666)
+
+	return sum, nil
+}
+
+// ReadMetadataSidecar reads name's "<file>.metadata.json" sidecar, if
+// one exists. It satisfies MetadataSidecarProvider.
+func (fs *LocalFilesystem) ReadMetadataSidecar(ctx context.Context, name string) (Metadata, bool, error) {
+	data, err := os.ReadFile(fs.nativePath(name) + metadataSidecarSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Metadata{}, false, nil
+		}
+		return Metadata{}, false, err
+	}
+	var md Metadata
+	if err := json.Unmarshal(data, &md); err != nil {
+		return Metadata{}, false, err
+	}
+	return md, true, nil
+}
+
+// WriteMetadataSidecar writes md to name's "<file>.metadata.json"
+// sidecar. It satisfies MetadataSidecarProvider.
+func (fs *LocalFilesystem) WriteMetadataSidecar(ctx context.Context, name string, md Metadata) error {
+	data, err := json.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fs.nativePath(name)+metadataSidecarSuffix, data, 0666)
+}
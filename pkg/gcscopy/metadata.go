@@ -0,0 +1,59 @@
+package gcscopy
+
+import "context"
+
+// ACLRule grants role to entity, mirroring storage.ACLRule in a form
+// that also serializes cleanly into a local metadata sidecar.
+type ACLRule struct {
+	Entity string `json:"entity"`
+	Role   string `json:"role"`
+}
+
+// Metadata holds the attributes Copier.PreserveMetadata carries
+// alongside a file's bytes: GCS-specific fields that have no local-disk
+// equivalent and so must be carried out-of-band via a sidecar file when
+// the destination is local.
+type Metadata struct {
+	ContentType        string            `json:"contentType,omitempty"`
+	ContentEncoding    string            `json:"contentEncoding,omitempty"`
+	CacheControl       string            `json:"cacheControl,omitempty"`
+	ContentDisposition string            `json:"contentDisposition,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+	StorageClass       string            `json:"storageClass,omitempty"`
+	ACL                []ACLRule         `json:"acl,omitempty"`
+}
+
+// MetadataInfo is implemented by FileInfo values that already carry
+// Metadata, such as a GCS object's attrs.
+type MetadataInfo interface {
+	Metadata() Metadata
+}
+
+// MetadataReceiver is implemented by File values that can accept
+// Metadata to stamp onto the file before it is finalized, such as a GCS
+// object writer.
+type MetadataReceiver interface {
+	SetMetadata(md Metadata)
+}
+
+// MetadataSidecarProvider is implemented by a Filesystem that has no
+// native attribute storage for Metadata and instead reads and writes it
+// to a sidecar file next to name, such as LocalFilesystem's
+// "<file>.metadata.json".
+type MetadataSidecarProvider interface {
+	ReadMetadataSidecar(ctx context.Context, name string) (md Metadata, ok bool, err error)
+	WriteMetadataSidecar(ctx context.Context, name string, md Metadata) error
+}
+
+// sourceMetadata returns name's Metadata, preferring a value already
+// carried by info and otherwise falling back to fs's sidecar, if it has
+// one. ok is false if neither source has Metadata for name.
+func sourceMetadata(ctx context.Context, fs Filesystem, name string, info FileInfo) (md Metadata, ok bool, err error) {
+	if mi, isMi := info.(MetadataInfo); isMi {
+		return mi.Metadata(), true, nil
+	}
+	if sp, isSp := fs.(MetadataSidecarProvider); isSp {
+		return sp.ReadMetadataSidecar(ctx, name)
+	}
+	return Metadata{}, false, nil
+}
@@ -0,0 +1,30 @@
+package gcscopy
+
+import "strings"
+
+// Rel returns the portion of target below root, using "/" as the
+// separator regardless of which Filesystem the paths belong to. Both
+// GcsFilesystem and LocalFilesystem paths are kept in this slash-separated form
+// internally so Copier never has to special-case either backend.
+func Rel(root, target string) (string, error) {
+	if root == "" {
+		return target, nil
+	}
+	rel := strings.TrimPrefix(target, root)
+	rel = strings.TrimPrefix(rel, "/")
+	return rel, nil
+}
+
+// Join appends rel to root using "/" as the separator.
+func Join(root, rel string) string {
+	if rel == "" {
+		return root
+	}
+	if root == "" {
+		return rel
+	}
+	if strings.HasSuffix(root, "/") {
+		return root + rel
+	}
+	return root + "/" + rel
+}
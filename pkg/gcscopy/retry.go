@@ -0,0 +1,103 @@
+package gcscopy
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// DefaultMaxRetries is the number of additional attempts after the
+	// first, used when a RetryPolicy does not set MaxRetries.
+	DefaultMaxRetries = 5
+	// DefaultRetryDeadline bounds the total time spent retrying a
+	// single chunk or file, used when a RetryPolicy does not set
+	// Deadline.
+	DefaultRetryDeadline = 10 * time.Minute
+
+	initialBackoff = 500 * time.Millisecond
+	maxBackoff     = 30 * time.Second
+)
+
+// RetryPolicy controls how Copier retries a chunk or file transfer
+// after a retryable error: HTTP 429, HTTP 5xx, context.DeadlineExceeded,
+// and connection resets/timeouts.
+type RetryPolicy struct {
+	// MaxRetries is the number of additional attempts after the first.
+	// Zero means DefaultMaxRetries.
+	MaxRetries int
+	// Deadline bounds the total time spent retrying, including the
+	// first attempt. Zero means DefaultRetryDeadline.
+	Deadline time.Duration
+}
+
+// withRetry calls fn, retrying it with exponential backoff and jitter
+// while the error is retryable, policy.MaxRetries has not been
+// exhausted, and policy.Deadline has not elapsed.
+func withRetry(ctx context.Context, policy RetryPolicy, fn func(ctx context.Context) error) error {
+	maxRetries := policy.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = DefaultMaxRetries
+	}
+	deadline := policy.Deadline
+	if deadline <= 0 {
+		deadline = DefaultRetryDeadline
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deadline)
+	defer cancel()
+
+	var err error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		err = fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if attempt == maxRetries || !isRetryable(err) {
+			return err
+		}
+
+		backoff := initialBackoff * time.Duration(math.Pow(2, float64(attempt)))
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		jitter := time.Duration(rand.Int63n(int64(backoff)))
+
+		select {
+		case <-time.After(jitter):
+		case <-ctx.Done():
+			return err
+		}
+	}
+	return err
+}
+
+// isRetryable reports whether err is a transient failure worth
+// retrying: HTTP 429, HTTP 5xx, context.DeadlineExceeded, or a
+// connection reset/timeout.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		if apiErr.Code == 429 || apiErr.Code >= 500 {
+			return true
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "connection reset") || strings.Contains(msg, "broken pipe")
+}